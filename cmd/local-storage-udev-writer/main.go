@@ -25,6 +25,7 @@ import (
 	"syscall"
 
 	"github.com/golang/glog"
+	utilexec "k8s.io/utils/exec"
 
 	"github.com/jsafrane/local-storage-udev-writer/pkg/udev-writer"
 )
@@ -42,6 +43,13 @@ var (
 	dns1123SubdomainRegexp = regexp.MustCompile("^" + dns1123SubdomainFmt + "$")
 )
 
+// Valid values of --udev-backend.
+const (
+	backendUdevadm = "udevadm"
+	backendSocket  = "socket"
+	backendDbus    = "dbus"
+)
+
 func main() {
 	var (
 		configFile  string
@@ -49,6 +57,8 @@ func main() {
 		rulesDir    string
 		useNSEnter  bool
 		hostProcDir string
+		udevBackend string
+		rawRules    bool
 	)
 
 	flag.StringVar(&configFile, "config", "/etc/local-storage-discoverer/rules.conf", "path to the configuration file")
@@ -57,6 +67,8 @@ func main() {
 	flag.StringVar(&rulesDir, "rules-dir", "/run/udev/rules.d", "path to udev rules.d directory where to pud udev rules")
 	flag.BoolVar(&useNSEnter, "use-nsenter", false, "use /bin/nsenter to enter host's mount namespace to execute udev commands")
 	flag.StringVar(&hostProcDir, "host-proc-dir", "/rootfs/proc", "path to host's /proc filesystems")
+	flag.StringVar(&udevBackend, "udev-backend", backendUdevadm, "how to tell udev to reload rules and re-trigger devices: one of udevadm, socket, dbus")
+	flag.BoolVar(&rawRules, "raw-rules", true, "treat the configuration file as freeform udev rules instead of a validated RulesConfig. Defaults to true so existing ConfigMaps keep working; set to false to require and validate a RulesConfig")
 	flag.Parse()
 
 	printVersion()
@@ -79,18 +91,33 @@ func main() {
 		glog.Fatalf("can't create directory for udev rules: %s", err)
 	}
 
-	var exec udevwriter.ExecInterface
-	if useNSEnter {
-		exec = udevwriter.NewNSEnterExec(hostProcDir)
-		glog.V(2).Infof("using nsenter")
-	} else {
-		exec = udevwriter.NewExec()
+	var controller udevwriter.UdevController
+	switch udevBackend {
+	case backendUdevadm:
+		var exec utilexec.Interface
+		if useNSEnter {
+			nsenterExec, err := udevwriter.NewNSEnterExec(hostProcDir)
+			if err != nil {
+				glog.Fatalf("can't set up nsenter: %s", err)
+			}
+			exec = nsenterExec
+			glog.V(2).Infof("using nsenter")
+		} else {
+			exec = udevwriter.NewExec()
+		}
+		controller = udevwriter.NewUdevadmController(exec)
+	case backendSocket:
+		controller = udevwriter.NewSocketController()
+	case backendDbus:
+		controller = udevwriter.NewDbusController()
+	default:
+		glog.Fatalf("invalid --udev-backend %q, must be one of %s, %s, %s", udevBackend, backendUdevadm, backendSocket, backendDbus)
 	}
 
 	// set up signals so we handle the first shutdown signal gracefully
 	stopCh := SetupSignalHandler()
 
-	u := udevwriter.NewUdevSync(configFile, rulesDir, name, exec)
+	u := udevwriter.NewUdevSync(configFile, rulesDir, name, controller, rawRules)
 	u.Run(stopCh)
 }
 
@@ -0,0 +1,140 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package async ports the bounded_frequency_runner pattern from
+// k8s.io/kubernetes/pkg/util/async, trimmed down to what this module needs.
+package async
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// BoundedFrequencyRunner manages runs of a function fn so that fn runs no
+// more often than minInterval, but also no less often than maxInterval.
+//
+// Run() asks for fn to be executed as soon as the minInterval bound allows;
+// a burst of Run() calls arriving while a run is already pending or in
+// flight coalesces into a single subsequent run. Loop() drives the actual
+// runs and blocks until stopCh is closed. fn is never invoked concurrently
+// with itself.
+type BoundedFrequencyRunner struct {
+	name        string
+	fn          func()
+	minInterval time.Duration
+	maxInterval time.Duration
+
+	// run is a 1-buffered channel: a pending request is a token in it.
+	run chan struct{}
+
+	mu      sync.Mutex
+	lastRun time.Time
+}
+
+// NewBoundedFrequencyRunner constructs a BoundedFrequencyRunner named name
+// that drives fn, running it no more than once per minInterval and no less
+// often than once per maxInterval.
+func NewBoundedFrequencyRunner(name string, fn func(), minInterval, maxInterval time.Duration) *BoundedFrequencyRunner {
+	return &BoundedFrequencyRunner{
+		name:        name,
+		fn:          fn,
+		minInterval: minInterval,
+		maxInterval: maxInterval,
+		run:         make(chan struct{}, 1),
+	}
+}
+
+// Run requests that fn be run as soon as minInterval allows. It never
+// blocks: if a run is already pending, this request is coalesced into it.
+func (bfr *BoundedFrequencyRunner) Run() {
+	select {
+	case bfr.run <- struct{}{}:
+	default:
+	}
+}
+
+// Loop runs fn according to the minInterval/maxInterval bounds until stopCh
+// is closed. It must be called from its own goroutine; it blocks.
+func (bfr *BoundedFrequencyRunner) Loop(stopCh <-chan struct{}) {
+	glog.V(3).Infof("%s: starting bounded frequency runner", bfr.name)
+	bfr.doRun()
+
+	timer := time.NewTimer(bfr.maxInterval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			glog.V(3).Infof("%s: stopping bounded frequency runner", bfr.name)
+			return
+
+		case <-bfr.run:
+			if wait := bfr.minInterval - time.Since(bfr.lastRunTime()); wait > 0 {
+				if !timer.Stop() {
+					<-timer.C
+				}
+				timer.Reset(wait)
+				select {
+				case <-timer.C:
+				case <-stopCh:
+					glog.V(3).Infof("%s: stopping bounded frequency runner", bfr.name)
+					return
+				}
+				// Any further Run() that arrived while we waited is
+				// satisfied by the run we're about to do.
+				select {
+				case <-bfr.run:
+				default:
+				}
+			}
+			bfr.doRun()
+
+		case <-timer.C:
+			bfr.doRun()
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(bfr.nextMaxWait())
+	}
+}
+
+func (bfr *BoundedFrequencyRunner) doRun() {
+	bfr.fn()
+	bfr.mu.Lock()
+	bfr.lastRun = time.Now()
+	bfr.mu.Unlock()
+}
+
+func (bfr *BoundedFrequencyRunner) lastRunTime() time.Time {
+	bfr.mu.Lock()
+	defer bfr.mu.Unlock()
+	return bfr.lastRun
+}
+
+func (bfr *BoundedFrequencyRunner) nextMaxWait() time.Duration {
+	wait := bfr.maxInterval - time.Since(bfr.lastRunTime())
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
@@ -1,67 +1,51 @@
 package udevwriter
 
 import (
+	"context"
 	"fmt"
-	osexec "os/exec"
 	"path/filepath"
-	"strings"
 
-	"github.com/golang/glog"
+	utilexec "k8s.io/utils/exec"
+	"k8s.io/utils/nsenter"
 )
 
-const (
-	mountNsPath = "1/ns/mnt"
-)
-
-// ExecInterface is an wrapper around exec().
-type ExecInterface interface {
-	Exec(cmd []string) ([]byte, error)
-}
-
-// NewExec returns ExecInterface that runs exec().
-func NewExec() ExecInterface {
-	return &exec{}
+// NewExec returns an exec.Interface that runs commands directly.
+func NewExec() utilexec.Interface {
+	return utilexec.New()
 }
 
-type exec struct{}
-
-var _ ExecInterface = &exec{}
-
-func (*exec) Exec(cmd []string) ([]byte, error) {
-	c := osexec.Command(cmd[0], cmd[1:]...)
-	out, err := c.CombinedOutput()
+// NewNSEnterExec returns an exec.Interface that runs every command inside
+// the host's mount namespace via nsenter, using hostProcDir as the path to
+// the host's /proc as seen from this process (e.g. "/rootfs/proc" when this
+// binary itself runs in a container). nsenter.NewNsenter needs the host's
+// root filesystem, not /proc itself, so it's derived here by stripping the
+// trailing "proc" component; this keeps --host-proc-dir as the single
+// user-facing knob instead of adding a second flag for the same mount.
+func NewNSEnterExec(hostProcDir string) (utilexec.Interface, error) {
+	hostRootFsPath := filepath.Dir(hostProcDir)
+	ne, err := nsenter.NewNsenter(hostRootFsPath, utilexec.New())
 	if err != nil {
-		glog.V(4).Infof("executed %s: %s (error: %v)", strings.Join(cmd, " "), string(out), err)
-	} else {
-		glog.V(4).Infof("executed %s: %s (success)", strings.Join(cmd, " "), string(out))
+		return nil, fmt.Errorf("failed to set up nsenter: %s", err)
 	}
-	return out, err
+	return &nsenterExec{ne: ne}, nil
 }
 
-// NewNSEnterExec returns ExecInterface that exectes commands in the host mount
-// namespace via nsenter.
-func NewNSEnterExec(hostProcDir string) ExecInterface {
-	return &nsenterExec{
-		hostProcDir: hostProcDir,
-	}
+// nsenterExec is an exec.Interface that runs every command through an
+// *nsenter.Nsenter, i.e. inside the host namespaces it was built for.
+type nsenterExec struct {
+	ne *nsenter.Nsenter
 }
 
-type nsenterExec struct {
-	hostProcDir string
+var _ utilexec.Interface = &nsenterExec{}
+
+func (n *nsenterExec) Command(cmd string, args ...string) utilexec.Cmd {
+	return n.ne.Exec(cmd, args)
 }
 
-var _ ExecInterface = &nsenterExec{}
+func (n *nsenterExec) CommandContext(ctx context.Context, cmd string, args ...string) utilexec.Cmd {
+	return n.Command(cmd, args...)
+}
 
-func (ne *nsenterExec) Exec(cmd []string) ([]byte, error) {
-	hostProcMountNsPath := filepath.Join(ne.hostProcDir, mountNsPath)
-	nsenterCmd := []string{"nsenter", fmt.Sprintf("--mount=%s", hostProcMountNsPath), "--"}
-	nsenterCmd = append(nsenterCmd, cmd...)
-	c := osexec.Command(nsenterCmd[0], nsenterCmd[1:]...)
-	out, err := c.CombinedOutput()
-	if err != nil {
-		glog.V(4).Infof("executed %s: %s (error: %v)", strings.Join(nsenterCmd, " "), string(out), err)
-	} else {
-		glog.V(4).Infof("executed %s: %s (success)", strings.Join(nsenterCmd, " "), string(out))
-	}
-	return out, err
+func (n *nsenterExec) LookPath(file string) (string, error) {
+	return n.ne.AbsHostPath(file), nil
 }
@@ -0,0 +1,129 @@
+package udevwriter
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// storageClassRegexp mirrors the DNS-1123 subdomain check
+// cmd/local-storage-udev-writer/main.go already applies to --name: the
+// storage class is rendered straight into a double-quoted udev rule value
+// and then used as a path component under /dev/disk/kubernetes, so it must
+// be safe on both counts.
+var storageClassRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
+// matchKeyRegexp allows the udev match keys this module knows how to render
+// safely, and nothing else: no GOTO, LABEL or RUN+=, which would let a
+// ConfigMap inject an arbitrary second udev rule statement.
+var matchKeyRegexp = regexp.MustCompile(`^(KERNEL|SUBSYSTEM|ENV\{[A-Za-z0-9_]+\}|ATTR\{[A-Za-z0-9_/]+\})$`)
+
+// MatchOp is a udev comparison operator.
+type MatchOp string
+
+const (
+	OpEqual    MatchOp = "=="
+	OpNotEqual MatchOp = "!="
+)
+
+// MatchClause is one "key op value" condition of a udev rule, e.g.
+// ENV{ID_FS_TYPE}=="ext4".
+type MatchClause struct {
+	Key   string  `json:"key"`
+	Op    MatchOp `json:"op"`
+	Value string  `json:"value"`
+}
+
+// RuleSet maps a set of match clauses, ANDed together, to a storage class:
+// any block device matching every clause in Match gets
+// ENV{KUBERNETES_STORAGE_CLASS} set to StorageClass.
+type RuleSet struct {
+	Match        []MatchClause `json:"match"`
+	StorageClass string        `json:"storageClass"`
+}
+
+// RulesConfig is the typed form of the operator-supplied ConfigMap.
+type RulesConfig struct {
+	Rules []RuleSet `json:"rules"`
+}
+
+// ParseRulesConfig parses and validates a RulesConfig from YAML (JSON is
+// valid YAML, so JSON-formatted ConfigMaps work too).
+func ParseRulesConfig(data []byte) (*RulesConfig, error) {
+	config := &RulesConfig{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %s", err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (c *RulesConfig) validate() error {
+	if len(c.Rules) == 0 {
+		return fmt.Errorf("config has no rules")
+	}
+	for i, rule := range c.Rules {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("rule %d: %s", i, err)
+		}
+	}
+	return nil
+}
+
+func (r *RuleSet) validate() error {
+	if len(r.Match) == 0 {
+		return fmt.Errorf("has no match clauses")
+	}
+	for _, m := range r.Match {
+		if err := m.validate(); err != nil {
+			return err
+		}
+	}
+	if !storageClassRegexp.MatchString(r.StorageClass) {
+		return fmt.Errorf("storageClass %q is not a valid name, must match %q", r.StorageClass, storageClassRegexp)
+	}
+	return nil
+}
+
+func (m *MatchClause) validate() error {
+	if !matchKeyRegexp.MatchString(m.Key) {
+		return fmt.Errorf("match key %q is not allowed, must match %q", m.Key, matchKeyRegexp)
+	}
+	if m.Op != OpEqual && m.Op != OpNotEqual {
+		return fmt.Errorf("match op %q must be %q or %q", m.Op, OpEqual, OpNotEqual)
+	}
+	if err := validateRuleValue(m.Value); err != nil {
+		return fmt.Errorf("match value for %s: %s", m.Key, err)
+	}
+	return nil
+}
+
+// validateRuleValue forbids characters that would let a value escape its
+// double-quoted udev rule field and inject a statement of its own.
+func validateRuleValue(value string) error {
+	if strings.ContainsAny(value, "\"\\\n") {
+		return fmt.Errorf("value %q must not contain quotes, backslashes or newlines", value)
+	}
+	return nil
+}
+
+// Render turns the validated config into the udev rule lines that go where
+// the {{.Rules}} section of udevFileTemplate expects them: one line per
+// RuleSet, ANDing its match clauses and assigning the storage class.
+func (c *RulesConfig) Render() string {
+	var buf bytes.Buffer
+	for _, rule := range c.Rules {
+		clauses := make([]string, 0, len(rule.Match)+1)
+		for _, m := range rule.Match {
+			clauses = append(clauses, fmt.Sprintf("%s%s%q", m.Key, m.Op, m.Value))
+		}
+		clauses = append(clauses, fmt.Sprintf("ENV{KUBERNETES_STORAGE_CLASS}=%q", rule.StorageClass))
+		fmt.Fprintln(&buf, strings.Join(clauses, ", "))
+	}
+	return buf.String()
+}
@@ -0,0 +1,76 @@
+package udevwriter
+
+import "testing"
+
+func TestParseRulesConfigValid(t *testing.T) {
+	yaml := `
+rules:
+- match:
+  - key: ENV{ID_FS_TYPE}
+    op: "=="
+    value: ext4
+  storageClass: fast-disks
+`
+	config, err := ParseRulesConfig([]byte(yaml))
+	if err != nil {
+		t.Fatalf("ParseRulesConfig() returned error: %s", err)
+	}
+
+	want := `ENV{ID_FS_TYPE}=="ext4", ENV{KUBERNETES_STORAGE_CLASS}="fast-disks"` + "\n"
+	if got := config.Render(); got != want {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+}
+
+func TestParseRulesConfigRejectsInjection(t *testing.T) {
+	cases := []struct {
+		name string
+		yaml string
+	}{
+		{
+			name: "forbidden match key",
+			yaml: `
+rules:
+- match:
+  - key: GOTO
+    op: "=="
+    value: out
+  storageClass: fast-disks
+`,
+		},
+		{
+			name: "quote in value",
+			yaml: `
+rules:
+- match:
+  - key: ENV{ID_FS_TYPE}
+    op: "=="
+    value: ext4", RUN+="/bin/evil
+  storageClass: fast-disks
+`,
+		},
+		{
+			name: "invalid storage class",
+			yaml: `
+rules:
+- match:
+  - key: ENV{ID_FS_TYPE}
+    op: "=="
+    value: ext4
+  storageClass: Not_Valid!
+`,
+		},
+		{
+			name: "no rules",
+			yaml: `rules: []`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := ParseRulesConfig([]byte(c.yaml)); err == nil {
+				t.Error("ParseRulesConfig() returned no error, want one")
+			}
+		})
+	}
+}
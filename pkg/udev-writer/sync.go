@@ -5,14 +5,29 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
-	"strings"
+	"path/filepath"
 	"text/template"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/golang/glog"
+
+	"github.com/jsafrane/local-storage-udev-writer/pkg/udev-writer/async"
 )
 
 const (
+	// minApplyInterval is the minInterval of the BoundedFrequencyRunner
+	// driving applyConfig: it throttles config updates that arrive faster
+	// than this, e.g. an operator flipping the ConfigMap repeatedly.
+	minApplyInterval = 2 * time.Second
+
+	// safetyRecheckInterval is the maxInterval of the same runner: the
+	// config is re-applied at least this often even when no fsnotify event
+	// was observed, in case an event got lost (e.g. the watch was installed
+	// after the ConfigMap volume remount raced with it) or udev state
+	// otherwise drifted.
+	safetyRecheckInterval = 5 * time.Minute
+
 	udevRulesTemplate = "99-kubernetes-%s.rules"
 	udevFileTemplate  = `
 # Generated file, do not modify!
@@ -35,6 +50,43 @@ LABEL="out"
 `
 )
 
+// configWatcher is the subset of *fsnotify.Watcher that UdevSync depends on,
+// pulled out so tests can inject a fake implementation that feeds it
+// synthetic events instead of watching the real filesystem.
+type configWatcher interface {
+	Events() <-chan fsnotify.Event
+	Errors() <-chan error
+	Close() error
+}
+
+type fsnotifyWatcher struct {
+	*fsnotify.Watcher
+}
+
+func (w *fsnotifyWatcher) Events() <-chan fsnotify.Event { return w.Watcher.Events }
+func (w *fsnotifyWatcher) Errors() <-chan error { return w.Watcher.Errors }
+
+// k8sAtomicWriterDataDir is the name of the symlink Kubernetes' AtomicWriter
+// (used for ConfigMap/Secret volumes) repoints at a new timestamped
+// directory on every update, instead of touching the leaf file itself.
+const k8sAtomicWriterDataDir = "..data"
+
+// newConfigWatcher watches the directory containing configFile, not the file
+// itself: Kubernetes updates a ConfigMap volume by rewriting the "..data"
+// symlink, which replaces the file instead of writing to it in place, and an
+// inotify watch on the old inode would never see that.
+func newConfigWatcher(configFile string) (configWatcher, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := w.Add(filepath.Dir(configFile)); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return &fsnotifyWatcher{w}, nil
+}
+
 type UdevSync struct {
 	// Unique name of node group, reused as rules filename.
 	name string
@@ -51,46 +103,116 @@ type UdevSync struct {
 	// Template of udev rules file.
 	udevTemplate *template.Template
 
-	// Exec interface to use
-	exec ExecInterface
+	// Controller used to reload udev rules and re-trigger block devices.
+	controller UdevController
+
+	// rawRules, when true, skips RulesConfig parsing/validation and uses the
+	// config file content verbatim as the {{.Rules}} section, for backward
+	// compatibility with freeform ConfigMaps.
+	rawRules bool
+
+	// newWatcher creates the watcher used to detect configFile changes.
+	// Overridden in tests to inject synthetic events.
+	newWatcher func(configFile string) (configWatcher, error)
+
+	// runner coalesces fsnotify events, the periodic safety re-check and the
+	// initial startup run into a single applyConfig at a time, throttled to
+	// minApplyInterval..safetyRecheckInterval.
+	runner *async.BoundedFrequencyRunner
 }
 
-func NewUdevSync(configFile, rulesPath, name string, exec ExecInterface) *UdevSync {
+func NewUdevSync(configFile, rulesPath, name string, controller UdevController, rawRules bool) *UdevSync {
 	rulesFile := path.Join(rulesPath, fmt.Sprintf(udevRulesTemplate, name))
 	glog.V(4).Infof("using rules file %s", rulesFile)
-	return &UdevSync{
+	u := &UdevSync{
 		name:         name,
 		configFile:   configFile,
 		rulesFile:    rulesFile,
 		udevTemplate: template.Must(template.New("rules").Parse(udevFileTemplate)),
-		exec:         exec,
+		controller:   controller,
+		rawRules:     rawRules,
+		newWatcher:   newConfigWatcher,
 	}
+	u.runner = async.NewBoundedFrequencyRunner(name+"-udev-sync", u.runApplyConfig, minApplyInterval, safetyRecheckInterval)
+	return u
 }
 
-func (u *UdevSync) Run(stopCh <-chan struct{}) {
-	// TODO: use inotify
-	ticker := time.NewTicker(time.Second)
-	defer ticker.Stop()
+// runApplyConfig is the function driven by u.runner: applyConfig errors are
+// logged and otherwise swallowed, matching how Run previously handled them.
+func (u *UdevSync) runApplyConfig() {
+	if err := u.applyConfig(); err != nil {
+		glog.Infof("failed to apply config: %s", err)
+	}
+}
 
-	err := u.applyConfig()
+func (u *UdevSync) Run(stopCh <-chan struct{}) {
+	watcher, err := u.newWatcher(u.configFile)
 	if err != nil {
-		glog.Infof("failed to apply config: %s", err)
+		// Not fatal: the runner's safety re-check still picks up changes,
+		// just less promptly.
+		glog.Errorf("failed to watch %s, falling back to re-checking every %s: %s", u.configFile, safetyRecheckInterval, err)
+	} else {
+		defer watcher.Close()
 	}
 
-	for {
-		select {
-		case <-ticker.C:
-			err := u.applyConfig()
-			if err != nil {
-				glog.Infof("failed to apply config: %s", err)
+	configFileName := filepath.Base(u.configFile)
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcherEvents(watcher):
+				if !ok {
+					return
+				}
+				// A ConfigMap volume update never touches configFile itself:
+				// Kubernetes' AtomicWriter repoints the "..data" symlink at a
+				// new directory, so that's the event we actually see.
+				base := filepath.Base(event.Name)
+				if base != configFileName && base != k8sAtomicWriterDataDir {
+					continue
+				}
+				if event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Rename) == 0 {
+					continue
+				}
+				glog.V(4).Infof("config file changed: %s", event)
+				u.runner.Run()
+
+			case err, ok := <-watcherErrors(watcher):
+				if !ok {
+					return
+				}
+				glog.Infof("config watcher error: %s", err)
+
+			case <-stopCh:
+				return
 			}
-
-		case <-stopCh:
-			glog.Infof("stopping")
-			u.removeUdevFile()
-			return
 		}
+	}()
+
+	// Blocks until stopCh is closed, running an initial applyConfig right
+	// away and then whenever the watcher goroutine above calls u.runner.Run(),
+	// never more often than minApplyInterval and never less often than
+	// safetyRecheckInterval.
+	u.runner.Loop(stopCh)
+
+	glog.Infof("stopping")
+	u.removeUdevFile()
+}
+
+// watcherEvents returns w.Events(), or a nil channel (which blocks forever in
+// a select) when w is nil, i.e. the watcher failed to start.
+func watcherEvents(w configWatcher) <-chan fsnotify.Event {
+	if w == nil {
+		return nil
 	}
+	return w.Events()
+}
+
+func watcherErrors(w configWatcher) <-chan error {
+	if w == nil {
+		return nil
+	}
+	return w.Errors()
 }
 
 func (u *UdevSync) applyConfig() error {
@@ -104,11 +226,16 @@ func (u *UdevSync) applyConfig() error {
 		return nil
 	}
 
-	if err := u.writeRulesFile(config); err != nil {
+	rules, err := u.renderRules(config)
+	if err != nil {
+		return fmt.Errorf("invalid rules config, keeping previous rules file in place: %s", err)
+	}
+
+	if err := u.writeRulesFile(rules); err != nil {
 		return err
 	}
 
-	if err := u.reloadUdev(); err != nil {
+	if err := u.controller.Reload(); err != nil {
 		return fmt.Errorf("failed to reload udev rules: %s", err)
 	}
 
@@ -117,7 +244,23 @@ func (u *UdevSync) applyConfig() error {
 	return nil
 }
 
-func (u *UdevSync) writeRulesFile(config []byte) error {
+// renderRules turns the raw ConfigMap content into the udev rule lines that
+// go into the {{.Rules}} section of udevFileTemplate. Unless --raw-rules
+// opted into the old pass-through behavior, config is parsed and validated
+// as a RulesConfig first, so a typo in the ConfigMap is rejected here
+// instead of being loaded into udev as broken rules.
+func (u *UdevSync) renderRules(config []byte) (string, error) {
+	if u.rawRules {
+		return string(config), nil
+	}
+	rulesConfig, err := ParseRulesConfig(config)
+	if err != nil {
+		return "", err
+	}
+	return rulesConfig.Render(), nil
+}
+
+func (u *UdevSync) writeRulesFile(rules string) error {
 	out, err := os.OpenFile(u.rulesFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
 	if err != nil {
 		return err
@@ -129,7 +272,7 @@ func (u *UdevSync) writeRulesFile(config []byte) error {
 		Rules string
 	}{
 		u.name,
-		string(config),
+		rules,
 	}
 
 	if err := u.udevTemplate.Execute(out, params); err != nil {
@@ -147,35 +290,13 @@ func (u *UdevSync) removeUdevFile() {
 	}
 	glog.V(2).Infof("udev file %s removed", u.rulesFile)
 
-	if err := u.reloadUdev(); err != nil {
+	if err := u.controller.Reload(); err != nil {
 		glog.Infof("error reloading udev: %s", err)
 	} else {
 		glog.V(2).Infof("udev reloaded")
 	}
 }
 
-func (u *UdevSync) reloadUdev() error {
-	commands := [][]string{
-		// Reload all rules files.
-		{"udevadm", "control", "--reload"},
-		// Pass all block devices through newly loaded rules
-		{"udevadm", "trigger", "--subsystem-match=block"},
-		// Block until all devices are processed
-		{"udevadm", "settle", "--timeout=300"},
-	}
-
-	for _, cmd := range commands {
-		out, err := u.exec.Exec(cmd)
-		if err != nil {
-			return fmt.Errorf("error executing %s: %s (%s))",
-				strings.Join(cmd, " "),
-				string(out),
-				err)
-		}
-	}
-	return nil
-}
-
 func (u *UdevSync) needApplyConfig(config []byte) bool {
 	if len(config) != len(u.oldConfigContent) {
 		return true
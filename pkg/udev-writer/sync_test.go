@@ -0,0 +1,162 @@
+package udevwriter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// fakeController is a minimal UdevController for tests that only care
+// whether and how often Reload was called, not what a real backend does.
+// Safe for concurrent use: Run() drives it from its own goroutine.
+type fakeController struct {
+	mu          sync.Mutex
+	reloadCalls int
+	reloadErr   error
+}
+
+var _ UdevController = &fakeController{}
+
+func (f *fakeController) Reload() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reloadCalls++
+	return f.reloadErr
+}
+
+func (f *fakeController) calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.reloadCalls
+}
+
+// fakeWatcher is a configWatcher whose events/errors a test drives directly,
+// instead of a real fsnotify watch on the filesystem.
+type fakeWatcher struct {
+	events chan fsnotify.Event
+	errors chan error
+}
+
+func newFakeWatcher() *fakeWatcher {
+	return &fakeWatcher{
+		events: make(chan fsnotify.Event, 1),
+		errors: make(chan error, 1),
+	}
+}
+
+func (w *fakeWatcher) Events() <-chan fsnotify.Event { return w.events }
+func (w *fakeWatcher) Errors() <-chan error          { return w.errors }
+func (w *fakeWatcher) Close() error                  { return nil }
+
+// waitForReloadCalls polls until controller has seen at least want Reload()
+// calls, or fails the test once it gives up waiting.
+func waitForReloadCalls(t *testing.T, controller *fakeController, want int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if controller.calls() >= want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d Reload() calls, got %d", want, controller.calls())
+}
+
+func newTestUdevSync(t *testing.T, controller UdevController) (*UdevSync, string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "udev-writer-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	configFile := filepath.Join(dir, "rules.conf")
+	if err := ioutil.WriteFile(configFile, []byte(`ENV{ID_FS_TYPE}=="ext4"`), 0600); err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("failed to write config file: %s", err)
+	}
+	// rawRules=true: these tests exercise the apply/reload plumbing, not
+	// RulesConfig parsing, which has its own tests in rules_config_test.go.
+	return NewUdevSync(configFile, dir, "test-group", controller, true), dir
+}
+
+func TestApplyConfigReloadsUdev(t *testing.T) {
+	controller := &fakeController{}
+	u, dir := newTestUdevSync(t, controller)
+	defer os.RemoveAll(dir)
+
+	if err := u.applyConfig(); err != nil {
+		t.Fatalf("applyConfig() returned error: %s", err)
+	}
+	if controller.calls() != 1 {
+		t.Errorf("got %d Reload() calls, want 1", controller.calls())
+	}
+	if _, err := os.Stat(u.rulesFile); err != nil {
+		t.Errorf("rules file %s was not written: %s", u.rulesFile, err)
+	}
+
+	// A second call with unchanged config content must not reload again.
+	if err := u.applyConfig(); err != nil {
+		t.Fatalf("applyConfig() returned error: %s", err)
+	}
+	if controller.calls() != 1 {
+		t.Errorf("got %d Reload() calls after unchanged config, want 1", controller.calls())
+	}
+}
+
+func TestRemoveUdevFileReloadsUdev(t *testing.T) {
+	controller := &fakeController{}
+	u, dir := newTestUdevSync(t, controller)
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(u.rulesFile, []byte("# rules"), 0600); err != nil {
+		t.Fatalf("failed to create rules file: %s", err)
+	}
+
+	u.removeUdevFile()
+
+	if _, err := os.Stat(u.rulesFile); !os.IsNotExist(err) {
+		t.Errorf("rules file %s still exists after removeUdevFile()", u.rulesFile)
+	}
+	if controller.calls() != 1 {
+		t.Errorf("got %d Reload() calls, want 1", controller.calls())
+	}
+}
+
+// TestRunAppliesOnDataSymlinkEvent exercises the fsnotify event filter in
+// Run(): Kubernetes' ConfigMap volumes never write configFile itself, they
+// repoint a "..data" symlink in its directory at a new revision.
+func TestRunAppliesOnDataSymlinkEvent(t *testing.T) {
+	controller := &fakeController{}
+	u, dir := newTestUdevSync(t, controller)
+	defer os.RemoveAll(dir)
+
+	fw := newFakeWatcher()
+	u.newWatcher = func(configFile string) (configWatcher, error) { return fw, nil }
+
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		u.Run(stopCh)
+		close(done)
+	}()
+	defer func() {
+		close(stopCh)
+		<-done
+	}()
+
+	// Run() always applies once at startup.
+	waitForReloadCalls(t, controller, 1)
+
+	// Change the underlying config so the event-driven apply has something
+	// new to pick up, then simulate the "..data" symlink swap.
+	if err := ioutil.WriteFile(u.configFile, []byte(`ENV{ID_FS_TYPE}=="xfs"`), 0600); err != nil {
+		t.Fatalf("failed to update config file: %s", err)
+	}
+	fw.events <- fsnotify.Event{Name: filepath.Join(dir, "..data"), Op: fsnotify.Create}
+
+	waitForReloadCalls(t, controller, 2)
+}
@@ -0,0 +1,43 @@
+package udevwriter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/golang/glog"
+)
+
+// sysfsBlockDir is where the kernel exposes one directory per block device;
+// writing "change" to a device's uevent file there re-triggers udev for it,
+// the same effect `udevadm trigger --subsystem-match=block` has.
+const sysfsBlockDir = "/sys/class/block"
+
+// UdevController tells udev to pick up newly written rules files and
+// re-evaluate existing block devices against them. UdevSync calls Reload
+// whenever it has written a new rules file.
+type UdevController interface {
+	Reload() error
+}
+
+// triggerBlockDevices re-triggers a "change" uevent for every device under
+// sysfsBlockDir, causing udevd to re-run its rules (including freshly
+// reloaded ones) against each of them.
+func triggerBlockDevices(sysfsBlockDir string) error {
+	entries, err := ioutil.ReadDir(sysfsBlockDir)
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %s", sysfsBlockDir, err)
+	}
+
+	var firstErr error
+	for _, entry := range entries {
+		ueventFile := filepath.Join(sysfsBlockDir, entry.Name(), "uevent")
+		if err := ioutil.WriteFile(ueventFile, []byte("change"), 0200); err != nil {
+			glog.Infof("failed to trigger %s: %s", ueventFile, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,58 @@
+package udevwriter
+
+import (
+	"fmt"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	// udevdUnit is the systemd unit that owns the udev rules; reloading it
+	// makes systemd-udevd re-read all rules files under /etc/udev/rules.d,
+	// /run/udev/rules.d and /usr/lib/udev/rules.d.
+	udevdUnit = "systemd-udevd.service"
+)
+
+// dbusController reloads udev by asking systemd, over D-Bus, to reload the
+// systemd-udevd unit, then re-triggers block devices the same way
+// socketController does. This avoids both a udevadm fork/exec and the udev
+// control socket, using only systemd's well-known system bus name.
+type dbusController struct {
+	unit          string
+	sysfsBlockDir string
+}
+
+// NewDbusController returns a UdevController that reloads udev via
+// systemd's D-Bus API.
+func NewDbusController() UdevController {
+	return &dbusController{
+		unit:          udevdUnit,
+		sysfsBlockDir: sysfsBlockDir,
+	}
+}
+
+var _ UdevController = &dbusController{}
+
+func (c *dbusController) Reload() error {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return fmt.Errorf("failed to connect to system D-Bus: %s", err)
+	}
+	defer conn.Close()
+
+	systemd := conn.Object("org.freedesktop.systemd1", dbus.ObjectPath("/org/freedesktop/systemd1"))
+
+	var jobPath dbus.ObjectPath
+	call := systemd.Call("org.freedesktop.systemd1.Manager.ReloadOrRestartUnit", 0, c.unit, "replace")
+	if call.Err != nil {
+		return fmt.Errorf("failed to reload %s: %s", c.unit, call.Err)
+	}
+	if err := call.Store(&jobPath); err != nil {
+		return fmt.Errorf("failed to reload %s: %s", c.unit, err)
+	}
+
+	if err := triggerBlockDevices(c.sysfsBlockDir); err != nil {
+		return fmt.Errorf("failed to trigger udev events: %s", err)
+	}
+	return nil
+}
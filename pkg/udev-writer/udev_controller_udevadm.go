@@ -0,0 +1,46 @@
+package udevwriter
+
+import (
+	"fmt"
+	"strings"
+
+	utilexec "k8s.io/utils/exec"
+)
+
+// udevadmController drives udev through the udevadm binary, exactly as an
+// operator typing the commands by hand would. This is the default backend:
+// it works everywhere udevadm is reachable, including through nsenter (see
+// NewNSEnterExec), at the cost of a few hundred ms of fork/exec per reload.
+type udevadmController struct {
+	exec utilexec.Interface
+}
+
+// NewUdevadmController returns a UdevController that shells out to udevadm
+// via exec.
+func NewUdevadmController(exec utilexec.Interface) UdevController {
+	return &udevadmController{exec: exec}
+}
+
+var _ UdevController = &udevadmController{}
+
+func (c *udevadmController) Reload() error {
+	commands := [][]string{
+		// Reload all rules files.
+		{"udevadm", "control", "--reload"},
+		// Pass all block devices through newly loaded rules.
+		{"udevadm", "trigger", "--subsystem-match=block"},
+		// Block until all devices are processed.
+		{"udevadm", "settle", "--timeout=300"},
+	}
+
+	for _, cmd := range commands {
+		out, err := c.exec.Command(cmd[0], cmd[1:]...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("error executing %s: %s (%s))",
+				strings.Join(cmd, " "),
+				string(out),
+				err)
+		}
+	}
+	return nil
+}
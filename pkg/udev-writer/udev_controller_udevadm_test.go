@@ -0,0 +1,86 @@
+package udevwriter
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	utilexec "k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+// reloadCommandArgv are the argv udevadmController must pass to exec, in
+// order, for a single successful Reload().
+var reloadCommandArgv = [][]string{
+	{"udevadm", "control", "--reload"},
+	{"udevadm", "trigger", "--subsystem-match=block"},
+	{"udevadm", "settle", "--timeout=300"},
+}
+
+// fakeReloadExec builds a FakeExec with one scripted command per entry of
+// results, handed out in order, returning results[i] for the i-th command.
+// The FakeExec records whatever argv it is called with and does not check it;
+// it returns the FakeCmds so the caller can assert the argv used.
+func fakeReloadExec(results []testingexec.FakeAction) (*testingexec.FakeExec, []*testingexec.FakeCmd) {
+	fake := &testingexec.FakeExec{ExactOrder: true}
+	cmds := make([]*testingexec.FakeCmd, 0, len(results))
+	for _, result := range results {
+		fcmd := &testingexec.FakeCmd{
+			CombinedOutputScript: []testingexec.FakeAction{result},
+		}
+		cmds = append(cmds, fcmd)
+		fake.CommandScript = append(fake.CommandScript, func(fcmd *testingexec.FakeCmd) testingexec.FakeCommandAction {
+			return func(cmd string, args ...string) utilexec.Cmd {
+				return testingexec.InitFakeCmd(fcmd, cmd, args...)
+			}
+		}(fcmd))
+	}
+	return fake, cmds
+}
+
+func succeed() ([]byte, []byte, error) { return []byte("ok"), nil, nil }
+
+// assertArgv checks that cmds[i].Argv matches reloadCommandArgv[i] for every
+// command in cmds, in order. cmds may be a prefix of reloadCommandArgv, e.g.
+// when a test stops the sequence early by injecting a failure.
+func assertArgv(t *testing.T, cmds []*testingexec.FakeCmd) {
+	t.Helper()
+	if len(cmds) > len(reloadCommandArgv) {
+		t.Fatalf("got %d commands, want at most %d", len(cmds), len(reloadCommandArgv))
+	}
+	for i, fcmd := range cmds {
+		if !reflect.DeepEqual(fcmd.Argv, reloadCommandArgv[i]) {
+			t.Errorf("command %d: got argv %v, want %v", i, fcmd.Argv, reloadCommandArgv[i])
+		}
+	}
+}
+
+func TestUdevadmControllerReloadSuccess(t *testing.T) {
+	fake, cmds := fakeReloadExec([]testingexec.FakeAction{succeed, succeed, succeed})
+	c := NewUdevadmController(fake)
+
+	if err := c.Reload(); err != nil {
+		t.Fatalf("Reload() returned error: %s", err)
+	}
+	assertArgv(t, cmds)
+}
+
+func TestUdevadmControllerReloadError(t *testing.T) {
+	wantErr := fmt.Errorf("udevadm exploded")
+	fake, cmds := fakeReloadExec([]testingexec.FakeAction{
+		succeed,
+		func() ([]byte, []byte, error) { return []byte("boom"), nil, wantErr },
+	})
+	c := NewUdevadmController(fake)
+
+	if err := c.Reload(); err == nil {
+		t.Fatal("Reload() returned no error, want one")
+	}
+
+	// Only the first two commands (reload, the failing trigger) should have
+	// run; settle must not be reached once trigger fails.
+	assertArgv(t, cmds[:2])
+	if fake.CommandCalls != 2 {
+		t.Errorf("got %d exec calls, want 2", fake.CommandCalls)
+	}
+}